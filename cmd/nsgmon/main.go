@@ -0,0 +1,212 @@
+// Command nsgmon enables NSG flow logs on an already-created Network
+// Security Group, then polls the storage account flow logs are written to
+// and prints per-rule hit counters grouped by source/destination IP and
+// port -- a "did my rules actually do what I intended?" feedback loop for
+// the network-go-manage-network-security-group sample.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Azure-Samples/network-go-manage-network-security-group/internal/config"
+	"github.com/Azure-Samples/network-go-manage-network-security-group/internal/iam"
+	"github.com/Azure-Samples/network-go-manage-network-security-group/pkg/flowlog"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-04-01/network"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const flowLogBlobPrefix = "insights-logs-networksecuritygroupflowevent/"
+
+var (
+	resourceGroup      string
+	nsgName            string
+	networkWatcherRG   string
+	networkWatcherName string
+	storageAccountID   string
+	storageAccountName string
+	storageAccountKey  string
+	retentionDays      uint
+	pollInterval       time.Duration
+	authMethod         string
+	cloud              string
+)
+
+func init() {
+	flag.StringVar(&resourceGroup, "resource-group", "", "Resource group containing the target Network Security Group.")
+	flag.StringVar(&nsgName, "nsg-name", "", "Name of the Network Security Group to enable flow logs on.")
+	flag.StringVar(&networkWatcherRG, "network-watcher-resource-group", "NetworkWatcherRG", "Resource group containing the regional Network Watcher.")
+	flag.StringVar(&networkWatcherName, "network-watcher-name", "", "Name of the regional Network Watcher.")
+	flag.StringVar(&storageAccountID, "storage-account-id", "", "Resource ID of the storage account flow logs should be written to.")
+	flag.StringVar(&storageAccountName, "storage-account-name", "", "Name of the storage account flow logs are written to, used to poll for new blobs.")
+	flag.StringVar(&storageAccountKey, "storage-account-key", os.Getenv("AZURE_STORAGE_ACCESS_KEY"), "Access key for -storage-account-name. Defaults to AZURE_STORAGE_ACCESS_KEY.")
+	flag.UintVar(&retentionDays, "retention-days", 7, "Number of days flow log blobs are retained before Azure deletes them.")
+	flag.DurationVar(&pollInterval, "poll-interval", 30*time.Second, "How often to list and parse new flow log blobs.")
+	flag.StringVar(&authMethod, "auth-method", string(iam.MethodServicePrincipal), "Authentication method to use: service-principal, device-flow, msi or cli.")
+	flag.StringVar(&cloud, "cloud", "", "Azure cloud to target: AzurePublicCloud, AzureChinaCloud, AzureUSGovernmentCloud, AzureGermanCloud, or a path ending in .json to an Azure Stack Hub metadata file. Defaults to AZURE_ENVIRONMENT, then AzurePublicCloud.")
+	flag.Parse()
+}
+
+func main() {
+	if "" == resourceGroup || "" == nsgName || "" == networkWatcherName || "" == storageAccountID || "" == storageAccountName {
+		fmt.Fprintln(os.Stderr, "Fatal Error: -resource-group, -nsg-name, -network-watcher-name, -storage-account-id and -storage-account-name are all required.")
+		os.Exit(1)
+	}
+
+	cfg, errs := config.Load(iam.Method(authMethod), config.Overrides{})
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "Invalid argument. Details: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	environment, err := config.ResolveEnvironment(cloud)
+	if nil != err {
+		fmt.Fprintf(os.Stderr, "Fatal Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	authorizer, err := iam.GetAuthorizer(iam.Method(authMethod), cfg, environment)
+	if nil != err {
+		fmt.Fprintf(os.Stderr, "Fatal Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	flowLogsClient := network.NewFlowLogsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	flowLogsClient.Authorizer = authorizer
+
+	nsgClient := network.NewSecurityGroupsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	nsgClient.Authorizer = authorizer
+
+	targetNSG, err := nsgClient.Get(ctx, resourceGroup, nsgName, "")
+	if nil != err {
+		fmt.Fprintf(os.Stderr, "Fatal Error: failed to look up Network Security Group %q: %v\n", nsgName, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Enabling flow logs on '%s'...", nsgName)
+	future, err := flowLogsClient.CreateOrUpdate(ctx, networkWatcherRG, networkWatcherName, nsgName, network.FlowLog{
+		Location: targetNSG.Location,
+		FlowLogPropertiesFormat: &network.FlowLogPropertiesFormat{
+			TargetResourceID: targetNSG.ID,
+			StorageID:        &storageAccountID,
+			Enabled:          to.BoolPtr(true),
+			Format: &network.FlowLogFormatParameters{
+				Type:    network.JSON,
+				Version: to.Int32Ptr(2),
+			},
+			RetentionPolicy: &network.RetentionPolicyParameters{
+				Days:    to.Int32Ptr(int32(retentionDays)),
+				Enabled: to.BoolPtr(retentionDays > 0),
+			},
+		},
+	})
+	if nil == err {
+		err = future.WaitForCompletionRef(ctx, flowLogsClient.Client)
+	}
+	if nil != err {
+		fmt.Println("FAILED")
+		fmt.Fprintf(os.Stderr, "\tError: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("SUCCESS")
+
+	credential, err := azblob.NewSharedKeyCredential(storageAccountName, storageAccountKey)
+	if nil != err {
+		fmt.Fprintf(os.Stderr, "Fatal Error: %v\n", err)
+		os.Exit(1)
+	}
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	containerURL, err := url.Parse(fmt.Sprintf("https://%s.blob.%s/insights-logs-networksecuritygroupflowevent", storageAccountName, environment.StorageEndpointSuffix))
+	if nil != err {
+		fmt.Fprintf(os.Stderr, "Fatal Error: %v\n", err)
+		os.Exit(1)
+	}
+	container := azblob.NewContainerURL(*containerURL, pipeline)
+
+	tracker := flowlog.NewTracker()
+	counters := flowlog.NewCounters()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	fmt.Printf("Polling '%s' every %s. Press Ctrl+C to stop.\n", flowLogBlobPrefix, pollInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			printCounters(counters)
+			return
+		case <-ticker.C:
+			updated, err := pollOnce(ctx, container, tracker)
+			if nil != err {
+				fmt.Fprintf(os.Stderr, "\tError polling flow logs: %v\n", err)
+			} else {
+				counters = updated
+			}
+			printCounters(counters)
+		}
+	}
+}
+
+// pollOnce lists every blob in the flow log container (flowLogBlobPrefix),
+// downloads it, and hands its parsed flow tuples to tracker, which replaces that blob's
+// prior contribution rather than adding to it -- flow log blobs are
+// rewritten in place with more records as traffic occurs, so a blob
+// downloaded a second time is not new traffic on top of the first.
+// It returns the merged totals across every blob seen so far.
+func pollOnce(ctx context.Context, container azblob.ContainerURL, tracker *flowlog.Tracker) (flowlog.Counters, error) {
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		listResp, err := container.ListBlobsFlatSegment(ctx, marker, azblob.ListBlobsSegmentOptions{})
+		if nil != err {
+			return nil, err
+		}
+		marker = listResp.NextMarker
+
+		for _, blobItem := range listResp.Segment.BlobItems {
+			blobURL := container.NewBlobURL(blobItem.Name)
+			downloadResp, err := blobURL.Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+			if nil != err {
+				return nil, err
+			}
+
+			body := downloadResp.Body(azblob.RetryReaderOptions{})
+			raw, err := ioutil.ReadAll(body)
+			body.Close()
+			if nil != err {
+				return nil, err
+			}
+
+			tuples, err := flowlog.ParseDocument(raw)
+			if nil != err {
+				return nil, fmt.Errorf("blob %q: %v", blobItem.Name, err)
+			}
+			tracker.Update(blobItem.Name, tuples)
+		}
+	}
+	return tracker.Totals(), nil
+}
+
+func printCounters(counters flowlog.Counters) {
+	fmt.Println("--- Rule hit counts ---")
+	for key, count := range counters {
+		fmt.Printf("%s: %d\n", key, count)
+	}
+}
@@ -0,0 +1,125 @@
+// Package config resolves the tenant, client and subscription identifiers
+// this sample needs to authenticate against Azure. Values are taken from
+// explicit overrides first, then environment variables, then a ".env" file
+// in the working directory, and are validated as well-formed GUIDs before
+// any client is constructed.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/marstr/guid"
+)
+
+// Environment variable names this package reads when the corresponding
+// flag override is empty.
+const (
+	EnvVarSubscriptionID = "AZURE_SUBSCRIPTION_ID"
+	EnvVarClientID       = "AZURE_CLIENT_ID"
+	EnvVarClientSecret   = "AZURE_CLIENT_SECRET"
+	EnvVarTenantID       = "AZURE_TENANT_ID"
+)
+
+// Config holds the identifiers and credentials needed to authenticate
+// against Azure and target a subscription.
+type Config struct {
+	SubscriptionID string
+	ClientID       string
+	ClientSecret   string
+	TenantID       string
+}
+
+// Method selects which credential flow the caller will authenticate with,
+// so that Load only requires the identifiers that flow actually needs.
+// iam.Method is an alias of this type: iam depends on config, not the
+// other way around, so the enum lives here.
+type Method string
+
+// Supported authentication methods.
+const (
+	MethodServicePrincipal Method = "service-principal"
+	MethodDeviceFlow       Method = "device-flow"
+	MethodMSI              Method = "msi"
+	MethodCLI              Method = "cli"
+)
+
+// Overrides carries flag values that, when non-empty, take precedence over
+// the environment and ".env" file.
+type Overrides struct {
+	SubscriptionID string
+	ClientID       string
+	ClientSecret   string
+	TenantID       string
+}
+
+// Load resolves a Config from overrides, the environment, and a ".env"
+// file (if present), in that order of precedence, and validates that every
+// identifier method actually needs is a well-formed GUID. SubscriptionID is
+// always required; MethodServicePrincipal additionally requires ClientID,
+// ClientSecret and TenantID, MethodDeviceFlow requires ClientID and
+// TenantID, MethodCLI requires only TenantID, and MethodMSI requires none
+// of them, mirroring iam.GetAuthorizer's own per-method requirements. Load
+// returns every validation problem it finds rather than stopping at the
+// first, matching the errors this sample has always reported.
+func Load(method Method, overrides Overrides) (Config, []error) {
+	godotenv.Load()
+
+	cfg := Config{
+		SubscriptionID: firstNonEmpty(overrides.SubscriptionID, os.Getenv(EnvVarSubscriptionID)),
+		ClientID:       firstNonEmpty(overrides.ClientID, os.Getenv(EnvVarClientID)),
+		ClientSecret:   firstNonEmpty(overrides.ClientSecret, os.Getenv(EnvVarClientSecret)),
+		TenantID:       firstNonEmpty(overrides.TenantID, os.Getenv(EnvVarTenantID)),
+	}
+
+	errs := make([]error, 0)
+	cfg.SubscriptionID = validateGUID("Azure Subscription ID", EnvVarSubscriptionID, cfg.SubscriptionID, &errs)
+
+	switch method {
+	case MethodServicePrincipal, "":
+		cfg.TenantID = validateGUID("Azure Tenant ID", EnvVarTenantID, cfg.TenantID, &errs)
+		cfg.ClientID = validateGUID("Azure Client ID", EnvVarClientID, cfg.ClientID, &errs)
+		if "" == cfg.ClientSecret {
+			errs = append(errs, newMissingAzureAuthError("Azure Client Secret", EnvVarClientSecret))
+		}
+	case MethodDeviceFlow:
+		cfg.TenantID = validateGUID("Azure Tenant ID", EnvVarTenantID, cfg.TenantID, &errs)
+		cfg.ClientID = validateGUID("Azure Client ID", EnvVarClientID, cfg.ClientID, &errs)
+	case MethodCLI:
+		cfg.TenantID = validateGUID("Azure Tenant ID", EnvVarTenantID, cfg.TenantID, &errs)
+	case MethodMSI:
+		// MSI authenticates as the VM's managed identity; it needs none of
+		// the tenant/client/secret identifiers.
+	}
+
+	return cfg, errs
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if "" != v {
+			return v
+		}
+	}
+	return ""
+}
+
+func validateGUID(pretty, envVarName, value string, errs *[]error) string {
+	if "" == value {
+		*errs = append(*errs, newMissingAzureAuthError(pretty, envVarName))
+		return value
+	}
+	parsed, err := guid.Parse(value)
+	if nil != err {
+		*errs = append(*errs, fmt.Errorf("argument '%s' was not of type Uuid as expected", envVarName))
+		return value
+	}
+	return parsed.Stringf(guid.FormatD)
+}
+
+func newMissingAzureAuthError(pretty string, envVarName string) error {
+	formatted := fmt.Sprintf("No value was provieded to act as the %s. Set enviroment variable \"%s\"", pretty, envVarName)
+	return errors.New(formatted)
+}
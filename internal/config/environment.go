@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// EnvVarEnvironment is the environment variable consulted when no cloud
+// override is given to ResolveEnvironment.
+const EnvVarEnvironment = "AZURE_ENVIRONMENT"
+
+// ResolveEnvironment resolves the Azure cloud (or Azure Stack Hub) this
+// sample should target. cloud may be a well-known environment name
+// (AzurePublicCloud, AzureChinaCloud, AzureUSGovernmentCloud,
+// AzureGermanCloud), a path to an Azure Stack Hub metadata JSON file, or
+// empty -- in which case AZURE_ENVIRONMENT is consulted, defaulting to
+// AzurePublicCloud. Only a value ending in ".json" is read as a file path;
+// any other value is looked up as an environment name.
+func ResolveEnvironment(cloud string) (azure.Environment, error) {
+	if "" == cloud {
+		cloud = os.Getenv(EnvVarEnvironment)
+	}
+	if "" == cloud {
+		return azure.PublicCloud, nil
+	}
+
+	if strings.HasSuffix(cloud, ".json") {
+		return azure.EnvironmentFromFile(cloud)
+	}
+	return azure.EnvironmentFromName(cloud)
+}
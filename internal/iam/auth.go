@@ -0,0 +1,123 @@
+// Package iam builds autorest.Authorizer instances for the four credential
+// flows this sample supports -- service principal, device-flow,
+// managed-identity (MSI) and Azure CLI -- so that main can obtain a working
+// authorizer from a single authMethod flag without knowing how each flow
+// talks to Azure AD.
+package iam
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Azure-Samples/network-go-manage-network-security-group/internal/config"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/cli"
+)
+
+// Method selects which credential flow GetAuthorizer uses. It is an alias
+// of config.Method, which config.Load uses to decide which identifiers it
+// requires for the same flow.
+type Method = config.Method
+
+// Supported authentication methods.
+const (
+	MethodServicePrincipal = config.MethodServicePrincipal
+	MethodDeviceFlow       = config.MethodDeviceFlow
+	MethodMSI              = config.MethodMSI
+	MethodCLI              = config.MethodCLI
+)
+
+// azureCLIClientID is the client ID the Azure CLI itself registers under;
+// it is well known and public, and is required to mint a token from a
+// manually-obtained CLI token.
+const azureCLIClientID = "04b07795-8ddb-461a-bbee-02f9e1bf7b46"
+
+// GetAuthorizer returns an autorest.Authorizer for the requested method.
+// cfg supplies the tenant/client identifiers the service-principal,
+// device-flow and CLI methods need; it is ignored by MethodMSI.
+func GetAuthorizer(method Method, cfg config.Config, env azure.Environment) (autorest.Authorizer, error) {
+	switch method {
+	case MethodServicePrincipal, "":
+		return servicePrincipalAuthorizer(cfg, env)
+	case MethodDeviceFlow:
+		return deviceFlowAuthorizer(cfg, env)
+	case MethodMSI:
+		return msiAuthorizer(env)
+	case MethodCLI:
+		return cliAuthorizer(cfg, env)
+	default:
+		return nil, fmt.Errorf("unrecognized authentication method %q", method)
+	}
+}
+
+func servicePrincipalAuthorizer(cfg config.Config, env azure.Environment) (autorest.Authorizer, error) {
+	oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, cfg.TenantID)
+	if nil != err {
+		return nil, err
+	}
+
+	token, err := adal.NewServicePrincipalToken(*oauthConfig, cfg.ClientID, cfg.ClientSecret, env.ResourceManagerEndpoint)
+	if nil != err {
+		return nil, err
+	}
+	return autorest.NewBearerAuthorizer(token), nil
+}
+
+func deviceFlowAuthorizer(cfg config.Config, env azure.Environment) (autorest.Authorizer, error) {
+	oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, cfg.TenantID)
+	if nil != err {
+		return nil, err
+	}
+
+	sender := &http.Client{}
+	deviceCode, err := adal.InitiateDeviceAuth(sender, *oauthConfig, cfg.ClientID, env.ResourceManagerEndpoint)
+	if nil != err {
+		return nil, err
+	}
+
+	fmt.Println(*deviceCode.Message)
+
+	deviceToken, err := adal.WaitForUserCompletion(sender, deviceCode)
+	if nil != err {
+		return nil, err
+	}
+
+	token, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, cfg.ClientID, env.ResourceManagerEndpoint, *deviceToken)
+	if nil != err {
+		return nil, err
+	}
+	return autorest.NewBearerAuthorizer(token), nil
+}
+
+func msiAuthorizer(env azure.Environment) (autorest.Authorizer, error) {
+	token, err := adal.NewServicePrincipalTokenFromManagedIdentity(env.ResourceManagerEndpoint, nil)
+	if nil != err {
+		return nil, err
+	}
+	return autorest.NewBearerAuthorizer(token), nil
+}
+
+func cliAuthorizer(cfg config.Config, env azure.Environment) (autorest.Authorizer, error) {
+	cliToken, err := cli.GetTokenFromCLI(env.ResourceManagerEndpoint)
+	if nil != err {
+		return nil, err
+	}
+
+	adalToken, err := cliToken.ToADALToken()
+	if nil != err {
+		return nil, err
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, cfg.TenantID)
+	if nil != err {
+		return nil, err
+	}
+
+	token, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, azureCLIClientID, env.ResourceManagerEndpoint, adalToken)
+	if nil != err {
+		return nil, err
+	}
+	return autorest.NewBearerAuthorizer(token), nil
+}
@@ -0,0 +1,70 @@
+package flowlog
+
+import "fmt"
+
+// Key identifies one aggregation bucket: a rule and the source/destination
+// IP and port it was observed on.
+type Key struct {
+	Rule     string
+	SourceIP string
+	DestIP   string
+	DestPort string
+}
+
+// String renders a Key for display, e.g. "ALLOW-SSH 10.0.0.4 -> 10.0.0.5:22".
+func (k Key) String() string {
+	return fmt.Sprintf("%s %s -> %s:%s", k.Rule, k.SourceIP, k.DestIP, k.DestPort)
+}
+
+// Counters accumulates per-rule, per-source/destination hit counts across
+// any number of tuples.
+type Counters map[Key]int
+
+// NewCounters returns an empty Counters.
+func NewCounters() Counters {
+	return make(Counters)
+}
+
+// Add folds tuples into the counters, keyed by rule and
+// source/destination IP and port.
+func (c Counters) Add(tuples []Tuple) {
+	for _, t := range tuples {
+		key := Key{Rule: t.Rule, SourceIP: t.SourceIP, DestIP: t.DestIP, DestPort: t.DestPort}
+		c[key]++
+	}
+}
+
+// Tracker accumulates hit counts across repeated polls of the same set of
+// blobs. NSG flow log blobs are rewritten in place for the duration of an
+// hour, gaining new records as traffic occurs, so re-downloading a blob
+// does not mean new traffic -- it means the same blob, now with more
+// records. Tracker keeps the latest per-blob snapshot and replaces it on
+// each call rather than adding on top of it, so a blob's contribution to
+// the merged total never double-counts tuples it reported on a prior poll.
+type Tracker struct {
+	perBlob map[string]Counters
+}
+
+// NewTracker returns a Tracker with no blobs seen yet.
+func NewTracker() *Tracker {
+	return &Tracker{perBlob: make(map[string]Counters)}
+}
+
+// Update replaces blobName's contribution with the counts derived from
+// tuples.
+func (t *Tracker) Update(blobName string, tuples []Tuple) {
+	snapshot := NewCounters()
+	snapshot.Add(tuples)
+	t.perBlob[blobName] = snapshot
+}
+
+// Totals returns the merged counts across every blob seen so far.
+func (t *Tracker) Totals() Counters {
+	total := NewCounters()
+	for _, counters := range t.perBlob {
+		for key, count := range counters {
+			total[key] += count
+		}
+	}
+	return total
+}
@@ -0,0 +1,52 @@
+package flowlog
+
+import "testing"
+
+func TestCountersAdd(t *testing.T) {
+	counters := NewCounters()
+	counters.Add([]Tuple{
+		{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"},
+		{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"},
+	})
+
+	key := Key{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"}
+	if got := counters[key]; got != 2 {
+		t.Errorf("counters[%v] = %d, want 2", key, got)
+	}
+}
+
+func TestTrackerUpdateReplacesRatherThanAccumulates(t *testing.T) {
+	tracker := NewTracker()
+	key := Key{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"}
+
+	// First poll of the blob observes one tuple.
+	tracker.Update("blob-1", []Tuple{
+		{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"},
+	})
+	if got := tracker.Totals()[key]; got != 1 {
+		t.Fatalf("Totals()[%v] = %d, want 1 after first poll", key, got)
+	}
+
+	// NSG flow log blobs are rewritten in place: a later poll of the same
+	// blob re-downloads the original tuple plus one new one. Update must
+	// replace blob-1's prior contribution, not add on top of it.
+	tracker.Update("blob-1", []Tuple{
+		{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"},
+		{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"},
+	})
+	if got := tracker.Totals()[key]; got != 2 {
+		t.Errorf("Totals()[%v] = %d, want 2 after re-polling the same blob", key, got)
+	}
+}
+
+func TestTrackerUpdateMergesAcrossBlobs(t *testing.T) {
+	tracker := NewTracker()
+	key := Key{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"}
+
+	tracker.Update("blob-1", []Tuple{{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"}})
+	tracker.Update("blob-2", []Tuple{{Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5", DestPort: "22"}})
+
+	if got := tracker.Totals()[key]; got != 2 {
+		t.Errorf("Totals()[%v] = %d, want 2 across two distinct blobs", key, got)
+	}
+}
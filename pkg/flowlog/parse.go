@@ -0,0 +1,61 @@
+package flowlog
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// ParseDocument parses a single flow log v2 JSON blob into its flattened
+// flow tuples.
+func ParseDocument(raw []byte) ([]Tuple, error) {
+	var doc Document
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	var tuples []Tuple
+	for _, record := range doc.Records {
+		for _, ruleFlows := range record.Properties.Flows {
+			for _, flow := range ruleFlows.Flows {
+				for _, raw := range flow.FlowTuples {
+					tuple, ok := parseTuple(ruleFlows.Rule, raw)
+					if ok {
+						tuples = append(tuples, tuple)
+					}
+				}
+			}
+		}
+	}
+	return tuples, nil
+}
+
+// parseTuple parses a single flowTuples entry. Malformed entries are
+// skipped rather than failing the whole blob. The first 8 fields are
+// required (present on both v1 and v2 tuples); the flow-state and
+// packet/byte counters that v2 appends are parsed when present.
+func parseTuple(rule, raw string) (Tuple, bool) {
+	fields := strings.Split(raw, ",")
+	if len(fields) < 8 {
+		return Tuple{}, false
+	}
+
+	tuple := Tuple{
+		Rule:       rule,
+		SourceIP:   fields[1],
+		DestIP:     fields[2],
+		SourcePort: fields[3],
+		DestPort:   fields[4],
+		Protocol:   fields[5],
+		Direction:  fields[6],
+		Decision:   fields[7],
+	}
+	if len(fields) >= 13 {
+		tuple.FlowState = fields[8]
+		tuple.PacketsSrcToDst, _ = strconv.ParseInt(fields[9], 10, 64)
+		tuple.BytesSrcToDst, _ = strconv.ParseInt(fields[10], 10, 64)
+		tuple.PacketsDstToSrc, _ = strconv.ParseInt(fields[11], 10, 64)
+		tuple.BytesDstToSrc, _ = strconv.ParseInt(fields[12], 10, 64)
+	}
+	return tuple, true
+}
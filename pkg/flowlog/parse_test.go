@@ -0,0 +1,84 @@
+package flowlog
+
+import "testing"
+
+func TestParseTuple(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want Tuple
+		ok   bool
+	}{
+		{
+			name: "v1 tuple (8 fields)",
+			raw:  "1556110496,10.0.0.4,10.0.0.5,53742,22,T,I,A",
+			want: Tuple{
+				Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5",
+				SourcePort: "53742", DestPort: "22", Protocol: "T",
+				Direction: "I", Decision: "A",
+			},
+			ok: true,
+		},
+		{
+			name: "v2 tuple (13 fields)",
+			raw:  "1556110496,10.0.0.4,10.0.0.5,53742,22,T,I,A,C,10,840,8,420",
+			want: Tuple{
+				Rule: "allow-ssh", SourceIP: "10.0.0.4", DestIP: "10.0.0.5",
+				SourcePort: "53742", DestPort: "22", Protocol: "T",
+				Direction: "I", Decision: "A", FlowState: "C",
+				PacketsSrcToDst: 10, BytesSrcToDst: 840,
+				PacketsDstToSrc: 8, BytesDstToSrc: 420,
+			},
+			ok: true,
+		},
+		{
+			name: "too few fields",
+			raw:  "1556110496,10.0.0.4,10.0.0.5,53742,22,T",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseTuple("allow-ssh", tt.raw)
+			if ok != tt.ok {
+				t.Fatalf("parseTuple() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("parseTuple() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDocument(t *testing.T) {
+	raw := []byte(`{
+		"records": [{
+			"time": "2019-04-24T15:14:56Z",
+			"properties": {
+				"Version": 2,
+				"flows": [{
+					"rule": "allow-ssh",
+					"flows": [{
+						"mac": "000D3A123456",
+						"flowTuples": [
+							"1556110496,10.0.0.4,10.0.0.5,53742,22,T,I,A,C,10,840,8,420",
+							"1556110497,10.0.0.4,10.0.0.5,53743,22,T,I,A,C,2,168,0,0"
+						]
+					}]
+				}]
+			}
+		}]
+	}`)
+
+	tuples, err := ParseDocument(raw)
+	if nil != err {
+		t.Fatalf("ParseDocument() error = %v", err)
+	}
+	if len(tuples) != 2 {
+		t.Fatalf("ParseDocument() returned %d tuples, want 2", len(tuples))
+	}
+	if tuples[0].Rule != "allow-ssh" || tuples[0].SourcePort != "53742" {
+		t.Errorf("ParseDocument()[0] = %+v", tuples[0])
+	}
+}
@@ -0,0 +1,57 @@
+// Package flowlog parses NSG flow log v2 records and aggregates them into
+// per-rule hit counters, so that users can confirm their security rules
+// actually matched the traffic they were written for.
+package flowlog
+
+// Record is a single top-level entry in an NSG flow log blob.
+type Record struct {
+	Time          string     `json:"time"`
+	ResourceID    string     `json:"resourceId"`
+	OperationName string     `json:"operationName"`
+	Properties    Properties `json:"properties"`
+}
+
+// Properties carries the per-rule flow data for a Record.
+type Properties struct {
+	Version int         `json:"Version"`
+	Flows   []RuleFlows `json:"flows"`
+}
+
+// RuleFlows groups the flows observed for a single security rule.
+type RuleFlows struct {
+	Rule  string `json:"rule"`
+	Flows []Flow `json:"flows"`
+}
+
+// Flow carries the raw, comma-separated flow tuples observed for one MAC
+// address under a rule.
+type Flow struct {
+	Mac        string   `json:"mac"`
+	FlowTuples []string `json:"flowTuples"`
+}
+
+// Document is the root object of a flow log v2 blob.
+type Document struct {
+	Records []Record `json:"records"`
+}
+
+// Tuple is a parsed v2 flow log tuple:
+// time,srcIP,dstIP,srcPort,dstPort,protocol,direction,decision,flowState,packetsSrcToDst,bytesSrcToDst,packetsDstToSrc,bytesDstToSrc
+//
+// FlowState and the packet/byte counters are only present on v2 tuples; on
+// a v1 tuple (8 fields) they are left at their zero value.
+type Tuple struct {
+	Rule            string
+	SourceIP        string
+	DestIP          string
+	SourcePort      string
+	DestPort        string
+	Protocol        string
+	Direction       string
+	Decision        string
+	FlowState       string
+	PacketsSrcToDst int64
+	BytesSrcToDst   int64
+	PacketsDstToSrc int64
+	BytesDstToSrc   int64
+}
@@ -0,0 +1,79 @@
+package nsg
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-04-01/network"
+)
+
+// ToSecurityRule converts a declarative Rule into the network.SecurityRule
+// type expected by the Azure SDK.
+func (r Rule) ToSecurityRule() (network.SecurityRule, error) {
+	direction, err := parseDirection(r.Direction)
+	if err != nil {
+		return network.SecurityRule{}, err
+	}
+
+	access, err := parseAccess(r.Access)
+	if err != nil {
+		return network.SecurityRule{}, err
+	}
+
+	protocol, err := parseProtocol(r.Protocol)
+	if err != nil {
+		return network.SecurityRule{}, err
+	}
+
+	name := r.Name
+	return network.SecurityRule{
+		Name: &name,
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Description:              &r.Description,
+			Priority:                 &r.Priority,
+			Direction:                direction,
+			Access:                   access,
+			Protocol:                 protocol,
+			SourceAddressPrefix:      &r.SourceAddressPrefix,
+			SourcePortRange:          &r.SourcePortRange,
+			DestinationAddressPrefix: &r.DestinationAddressPrefix,
+			DestinationPortRange:     &r.DestinationPortRange,
+		},
+	}, nil
+}
+
+func parseDirection(s string) (network.SecurityRuleDirection, error) {
+	switch s {
+	case "Inbound":
+		return network.SecurityRuleDirectionInbound, nil
+	case "Outbound":
+		return network.SecurityRuleDirectionOutbound, nil
+	default:
+		return "", fmt.Errorf("unrecognized direction %q (expected Inbound or Outbound)", s)
+	}
+}
+
+func parseAccess(s string) (network.SecurityRuleAccess, error) {
+	switch s {
+	case "Allow":
+		return network.SecurityRuleAccessAllow, nil
+	case "Deny":
+		return network.SecurityRuleAccessDeny, nil
+	default:
+		return "", fmt.Errorf("unrecognized access %q (expected Allow or Deny)", s)
+	}
+}
+
+func parseProtocol(s string) (network.SecurityRuleProtocol, error) {
+	switch s {
+	case "Tcp":
+		return network.SecurityRuleProtocolTCP, nil
+	case "Udp":
+		return network.SecurityRuleProtocolUDP, nil
+	case "Icmp":
+		return network.SecurityRuleProtocolIcmp, nil
+	case "*":
+		return network.SecurityRuleProtocolAsterisk, nil
+	default:
+		return "", fmt.Errorf("unrecognized protocol %q (expected Tcp, Udp, Icmp or *)", s)
+	}
+}
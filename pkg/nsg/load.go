@@ -0,0 +1,35 @@
+package nsg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LoadFile reads a declarative rule-set from path. The format is inferred
+// from the file extension: ".yaml"/".yml" is parsed as YAML, ".json" as
+// JSON. HCL rule-sets, in the style of Terraform's azurerm_security_group,
+// are not yet supported.
+func LoadFile(path string) (RuleSet, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return RuleSet{}, err
+	}
+
+	var set RuleSet
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &set)
+	case ".json":
+		err = json.Unmarshal(raw, &set)
+	default:
+		return RuleSet{}, fmt.Errorf("unrecognized rule-set extension %q (expected .yaml, .yml or .json)", ext)
+	}
+	if err != nil {
+		return RuleSet{}, fmt.Errorf("failed to parse rule-set %q: %v", path, err)
+	}
+	return set, nil
+}
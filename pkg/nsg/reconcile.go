@@ -0,0 +1,134 @@
+package nsg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-04-01/network"
+)
+
+// ReconcileOptions controls how Reconcile treats rules that exist on a
+// Network Security Group but are not present in the desired rule-set.
+type ReconcileOptions struct {
+	// Prune, when true, deletes existing rules that are not present in the
+	// desired rule-set and whose name carries PrunePrefix.
+	Prune bool
+	// PrunePrefix scopes deletion to rules this tool is known to own, so
+	// that rules declared by other tooling are left untouched.
+	PrunePrefix string
+}
+
+// Reconcile diffs the rules declared for a Network Security Group against
+// the rules that currently exist on it: it creates missing rules, updates
+// rules whose declaration has changed (by name, comparing every field the
+// caller can declare), leaves rules whose declaration is unchanged alone,
+// and -- when opts.Prune is set -- deletes existing rules carrying
+// opts.PrunePrefix that are no longer declared. It is safe to call
+// repeatedly; a second call against an unchanged rule-set is a no-op.
+func Reconcile(ctx context.Context, client network.SecurityRulesClient, resourceGroupName, networkSecurityGroupName string, desired []Rule, opts ReconcileOptions) error {
+	existing := make(map[string]network.SecurityRule)
+	page, err := client.List(ctx, resourceGroupName, networkSecurityGroupName)
+	if nil != err {
+		return fmt.Errorf("failed to list existing rules for %q: %v", networkSecurityGroupName, err)
+	}
+	for ; page.NotDone(); err = page.NextWithContext(ctx) {
+		if nil != err {
+			return fmt.Errorf("failed to list existing rules for %q: %v", networkSecurityGroupName, err)
+		}
+		for _, rule := range page.Values() {
+			existing[*rule.Name] = rule
+		}
+	}
+
+	declaredNames := make(map[string]bool, len(desired))
+	for _, declaredRule := range desired {
+		declaredNames[declaredRule.Name] = true
+
+		securityRule, err := declaredRule.ToSecurityRule()
+		if nil != err {
+			return fmt.Errorf("rule %q: %v", declaredRule.Name, err)
+		}
+
+		if existingRule, ok := existing[declaredRule.Name]; ok && securityRulesEqual(existingRule, securityRule) {
+			continue
+		}
+
+		future, err := client.CreateOrUpdate(ctx, resourceGroupName, networkSecurityGroupName, declaredRule.Name, securityRule)
+		if nil == err {
+			err = future.WaitForCompletionRef(ctx, client.Client)
+		}
+		if nil != err {
+			return fmt.Errorf("failed to reconcile rule %q: %v", declaredRule.Name, err)
+		}
+	}
+
+	if !opts.Prune {
+		return nil
+	}
+
+	for name := range existing {
+		if declaredNames[name] {
+			continue
+		}
+		if "" != opts.PrunePrefix && !strings.HasPrefix(name, opts.PrunePrefix) {
+			continue
+		}
+
+		future, err := client.Delete(ctx, resourceGroupName, networkSecurityGroupName, name)
+		if nil == err {
+			err = future.WaitForCompletionRef(ctx, client.Client)
+		}
+		if nil != err {
+			resp := future.Response()
+			if nil == resp || http.StatusNotFound != resp.StatusCode {
+				return fmt.Errorf("failed to delete obsolete rule %q: %v", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// securityRulesEqual reports whether existing already matches every field
+// a rule-set file can declare for desired, so that Reconcile can skip a
+// CreateOrUpdate that would be a no-op. Server-populated fields such as
+// ProvisioningState and Etag are intentionally not compared.
+func securityRulesEqual(existing, desired network.SecurityRule) bool {
+	e, d := existing.SecurityRulePropertiesFormat, desired.SecurityRulePropertiesFormat
+	if nil == e || nil == d {
+		return nil == e && nil == d
+	}
+	return stringPtrEqual(e.Description, d.Description) &&
+		int32PtrEqual(e.Priority, d.Priority) &&
+		e.Direction == d.Direction &&
+		e.Access == d.Access &&
+		e.Protocol == d.Protocol &&
+		stringPtrEqual(e.SourceAddressPrefix, d.SourceAddressPrefix) &&
+		stringPtrEqual(e.SourcePortRange, d.SourcePortRange) &&
+		stringPtrEqual(e.DestinationAddressPrefix, d.DestinationAddressPrefix) &&
+		stringPtrEqual(e.DestinationPortRange, d.DestinationPortRange)
+}
+
+func stringPtrEqual(a, b *string) bool {
+	var av, bv string
+	if nil != a {
+		av = *a
+	}
+	if nil != b {
+		bv = *b
+	}
+	return av == bv
+}
+
+func int32PtrEqual(a, b *int32) bool {
+	var av, bv int32
+	if nil != a {
+		av = *a
+	}
+	if nil != b {
+		bv = *b
+	}
+	return av == bv
+}
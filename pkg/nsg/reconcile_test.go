@@ -0,0 +1,91 @@
+package nsg
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-04-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func mustSecurityRule(t *testing.T, r Rule) network.SecurityRule {
+	t.Helper()
+	securityRule, err := r.ToSecurityRule()
+	if nil != err {
+		t.Fatalf("ToSecurityRule(%+v): %v", r, err)
+	}
+	return securityRule
+}
+
+func TestSecurityRulesEqual(t *testing.T) {
+	base := Rule{
+		Name:                     "allow-ssh",
+		Description:              "allow inbound SSH",
+		Priority:                 100,
+		Direction:                "Inbound",
+		Access:                   "Allow",
+		Protocol:                 "Tcp",
+		SourceAddressPrefix:      "10.0.0.0/24",
+		SourcePortRange:          "*",
+		DestinationAddressPrefix: "10.0.1.0/24",
+		DestinationPortRange:     "22",
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(Rule) Rule
+		wantEqu bool
+	}{
+		{
+			name:    "identical declaration",
+			mutate:  func(r Rule) Rule { return r },
+			wantEqu: true,
+		},
+		{
+			name:    "changed priority",
+			mutate:  func(r Rule) Rule { r.Priority = 200; return r },
+			wantEqu: false,
+		},
+		{
+			name:    "changed description",
+			mutate:  func(r Rule) Rule { r.Description = "changed"; return r },
+			wantEqu: false,
+		},
+		{
+			name:    "changed direction",
+			mutate:  func(r Rule) Rule { r.Direction = "Outbound"; return r },
+			wantEqu: false,
+		},
+		{
+			name:    "changed protocol",
+			mutate:  func(r Rule) Rule { r.Protocol = "Udp"; return r },
+			wantEqu: false,
+		},
+		{
+			name:    "changed destination port range",
+			mutate:  func(r Rule) Rule { r.DestinationPortRange = "2222"; return r },
+			wantEqu: false,
+		},
+	}
+
+	existing := mustSecurityRule(t, base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := mustSecurityRule(t, tt.mutate(base))
+			if got := securityRulesEqual(existing, desired); got != tt.wantEqu {
+				t.Errorf("securityRulesEqual() = %v, want %v", got, tt.wantEqu)
+			}
+		})
+	}
+}
+
+func TestSecurityRulesEqualMissingProperties(t *testing.T) {
+	withProps := mustSecurityRule(t, Rule{Name: "r", Direction: "Inbound", Access: "Allow", Protocol: "*"})
+	noProps := network.SecurityRule{Name: to.StringPtr("r")}
+
+	if securityRulesEqual(noProps, withProps) {
+		t.Error("securityRulesEqual() = true, want false when desired has properties and existing does not")
+	}
+	if !securityRulesEqual(noProps, noProps) {
+		t.Error("securityRulesEqual() = false, want true when neither rule has properties")
+	}
+}
@@ -0,0 +1,44 @@
+// Package nsg provides a declarative model for Azure Network Security
+// Groups and their rules, so that a rule-set file can describe the desired
+// security posture of a deployment instead of hard-coding SecurityRule
+// literals in main.
+package nsg
+
+// RuleSet is the root of a declarative rule-set file. It describes the
+// subnets to create, the Network Security Groups to attach to them, and the
+// rules enforced on each group.
+type RuleSet struct {
+	Subnets []Subnet `json:"subnets" yaml:"subnets"`
+	Groups  []Group  `json:"groups" yaml:"groups"`
+}
+
+// Subnet describes a subnet to create within the sample's virtual network
+// and the Network Security Group, by name, that should be attached to it.
+type Subnet struct {
+	Name          string `json:"name" yaml:"name"`
+	AddressPrefix string `json:"addressPrefix" yaml:"addressPrefix"`
+	Group         string `json:"group" yaml:"group"`
+}
+
+// Group describes a single Network Security Group and the rules declared
+// for it.
+type Group struct {
+	Name  string `json:"name" yaml:"name"`
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule is the declarative equivalent of network.SecurityRule: it captures
+// the fields a user can set for a single security rule without requiring
+// them to construct SDK types, or recompile the sample, directly.
+type Rule struct {
+	Name                     string `json:"name" yaml:"name"`
+	Description              string `json:"description" yaml:"description"`
+	Priority                 int32  `json:"priority" yaml:"priority"`
+	Direction                string `json:"direction" yaml:"direction"` // Inbound | Outbound
+	Access                   string `json:"access" yaml:"access"`       // Allow | Deny
+	Protocol                 string `json:"protocol" yaml:"protocol"`   // Tcp | Udp | Icmp | *
+	SourceAddressPrefix      string `json:"sourceAddressPrefix" yaml:"sourceAddressPrefix"`
+	SourcePortRange          string `json:"sourcePortRange" yaml:"sourcePortRange"`
+	DestinationAddressPrefix string `json:"destinationAddressPrefix" yaml:"destinationAddressPrefix"`
+	DestinationPortRange     string `json:"destinationPortRange" yaml:"destinationPortRange"`
+}
@@ -1,24 +1,23 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/arm/network"
-	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure-Samples/network-go-manage-network-security-group/internal/config"
+	"github.com/Azure-Samples/network-go-manage-network-security-group/internal/iam"
+	"github.com/Azure-Samples/network-go-manage-network-security-group/pkg/nsg"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-04-01/network"
+	"github.com/Azure/azure-sdk-for-go/services/resources/mgmt/2019-05-01/resources"
 	"github.com/Azure/go-autorest/autorest"
-	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure"
-	"github.com/Azure/go-autorest/autorest/to"
-	"github.com/marstr/guid"
 )
 
 const (
@@ -26,21 +25,11 @@ const (
 	sampleSecurityGroupLabel string = "Auto-generated Go-Sample Network Security Group"
 )
 
-// Authentication environment variable names.
-const (
-	azureEnvVarNameSubscriptionID string = "AZURE_SUBSCRIPTION_ID"
-	azureEnvVarNameClientID       string = "AZURE_CLIENT_ID"
-	azureEnvVarNameClientSecret   string = "AZURE_CLIENT_SECRET"
-	azureEnvVarNameTenantID       string = "AZURE_TENANT_ID"
-)
-
-// Authentication environment variable values & the
+// Resolved configuration, authorizer and cloud environment, set up in init().
 var (
-	subscriptionID string
-	clientID       string
-	clientSecret   string
-	tenantID       string
-	token          *adal.ServicePrincipalToken
+	cfg         config.Config
+	authorizer  autorest.Authorizer
+	environment azure.Environment
 )
 
 // User adjustable variables to customized execution environment depending on
@@ -51,10 +40,21 @@ var (
 
 // Capture flow control options as defined by the arguments provided to this program.
 var (
-	output io.Writer
-	pause  bool
-	delay  uint
-	help   bool
+	output      io.Writer
+	pause       bool
+	delay       uint
+	help        bool
+	rulesFile   string
+	reconcile   bool
+	prune       bool
+	prunePrefix string
+	authMethod  string
+	cloud       string
+
+	flagSubscriptionID string
+	flagClientID       string
+	flagClientSecret   string
+	flagTenantID       string
 )
 
 // Exit status codes associated with various error cases.
@@ -66,6 +66,7 @@ const (
 	ExitNetworkSecuritryGroupCreationFailure
 	ExitSecurityRuleCreationFailure
 	ExitSubnetCreationFailure
+	ExitRuleSetLoadFailure
 )
 
 func main() {
@@ -79,188 +80,131 @@ func main() {
 	}
 
 	//Ensure authentication is setup correctly before continuing.
-	if nil == token {
+	if nil == authorizer {
 		fmt.Fprintln(os.Stderr, "Fatal Error: Authentication Failed.")
 		exitStatus = ExitAuthenticationFailure
 		return
 	}
 
-	bearer := autorest.NewBearerAuthorizer(token)
+	bearer := authorizer
 
-	cancel := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Make an isolated environment to store assets created for this sample.
-	resourceGroupClient, resourceGroupName, err := createResourceGroup(cancel)
+	resourceGroupClient, resourceGroupName, err := createResourceGroup(ctx)
 	if err != nil {
 		exitStatus = ExitResourceGroupCreationFailure
 		return
 	}
-	defer deleteResourceGroup(resourceGroupClient, resourceGroupName, cancel)
+	defer deleteResourceGroup(ctx, resourceGroupClient, resourceGroupName)
 
 	// Create a network that will be the target of network security groups
-	_, vNetName, err := createVirtualNetwork(resourceGroupName, cancel)
+	_, vNetName, err := createVirtualNetwork(ctx, resourceGroupName)
 	if nil != err {
 		exitStatus = ExitVirtualNetworkCreationFailure
 		return
 	}
 
-	// Create two Network Security Groups, one to be used for front-end requests, another for back-end
-	nsgClient := network.NewSecurityGroupsClient(subscriptionID)
-	nsgClient.Authorizer = bearer
-
-	frontEndNSG, err := createNetworkSecurityGroup(nsgClient, resourceGroupName, "frontend", cancel)
+	// Load the declarative rule-set describing the Network Security Groups,
+	// subnets and rules to reconcile against this subscription.
+	ruleSet, err := nsg.LoadFile(rulesFile)
 	if nil != err {
-		exitStatus = ExitNetworkSecuritryGroupCreationFailure
+		fmt.Fprintf(os.Stderr, "Fatal Error: %v\n", err)
+		exitStatus = ExitRuleSetLoadFailure
 		return
 	}
 
-	backEndNSG, err := createNetworkSecurityGroup(nsgClient, resourceGroupName, "backend", cancel)
-	if nil != err {
-		exitStatus = ExitNetworkSecuritryGroupCreationFailure
-		return
-	}
-
-	//Create Subnets to host Virtual Machines which will be protected by the rules above.
-	subNetClient := network.NewSubnetsClient(subscriptionID)
-	subNetClient.Authorizer = bearer
-
-	frontendAddressPrefix := to.StringPtr("192.168.1.0/24")
-	frontendSubnet := network.Subnet{
-		Name: to.StringPtr("frontendSubnet"),
-		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
-			AddressPrefix:        frontendAddressPrefix,
-			NetworkSecurityGroup: &frontEndNSG,
-		},
-	}
-
-	backendAddressPrefix := to.StringPtr("192.168.2.0/24")
-	backendSubnet := network.Subnet{
-		Name: to.StringPtr("backendSubnet"),
-		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
-			AddressPrefix:        backendAddressPrefix,
-			NetworkSecurityGroup: &backEndNSG,
-		},
-	}
-
-	_, err = executeWithStatus(func() (resp autorest.Response, err error) {
-		respChan, errChan := subNetClient.CreateOrUpdate(resourceGroupName, vNetName, *frontendSubnet.Name, frontendSubnet, cancel)
-		resp, err = (<-respChan).Response, <-errChan
-		return
-	}, fmt.Sprintf("Creating Subnet '%s'", *frontendSubnet.Name))
-	if err != nil {
-		exitStatus = ExitSubnetCreationFailure
-		return
-	}
+	// Create a Network Security Group, and its declared rules, for every
+	// group in the rule-set (e.g. front-end and back-end).
+	nsgClient := network.NewSecurityGroupsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	nsgClient.Authorizer = bearer
 
-	_, err = executeWithStatus(func() (autorest.Response, error) {
-		respChan, errChan := subNetClient.CreateOrUpdate(resourceGroupName, vNetName, *backendSubnet.Name, backendSubnet, cancel)
-		return (<-respChan).Response, <-errChan
-	}, fmt.Sprintf("Creating Subnet '%s'", *backendSubnet.Name))
-	if err != nil {
-		exitStatus = ExitSubnetCreationFailure
-		return
-	}
+	ruleClient := network.NewSecurityRulesClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	ruleClient.Authorizer = bearer
 
-	// Create the security rules that should be enforced, and associate them with their respective security group.
-	ruleClient := network.NewSecurityRulesClient(subscriptionID)
-	ruleClient.Authorizer = autorest.NewBearerAuthorizer(token)
-
-	anyPortRange := "*"
-	anyAddressPrefix := "*"
-
-	sshPortRange := "22"
-	sshRuleDesc := "Allow SSH"
-	sshRulePriority := int32(100)
-	frontendSSHRuleName := "ALLOW-SSH"
-	frontendSSHRule := network.SecurityRule{
-		Name: &frontendSSHRuleName,
-		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
-			Access: network.SecurityRuleAccessAllow,
-			DestinationAddressPrefix: &anyAddressPrefix,
-			DestinationPortRange:     &sshPortRange,
-			Direction:                network.SecurityRuleDirectionInbound,
-			Description:              &sshRuleDesc,
-			Priority:                 &sshRulePriority,
-			Protocol:                 network.SecurityRuleProtocolTCP,
-			SourceAddressPrefix:      &anyAddressPrefix,
-			SourcePortRange:          &anyPortRange,
-		},
-	}
+	groups := make(map[string]network.SecurityGroup, len(ruleSet.Groups))
+	for _, group := range ruleSet.Groups {
+		createdGroup, err := createNetworkSecurityGroup(ctx, nsgClient, resourceGroupName, group.Name)
+		if nil != err {
+			exitStatus = ExitNetworkSecuritryGroupCreationFailure
+			return
+		}
+		groups[group.Name] = createdGroup
+
+		if reconcile {
+			fmt.Fprintf(output, "Reconciling Security Rules for '%s'...", group.Name)
+			err := nsg.Reconcile(ctx, ruleClient, resourceGroupName, group.Name, group.Rules, nsg.ReconcileOptions{
+				Prune:       prune,
+				PrunePrefix: prunePrefix,
+			})
+			if nil != err {
+				fmt.Fprintln(output, "FAILED")
+				fmt.Fprintf(os.Stderr, "\tError: %v\n", err)
+				exitStatus = ExitSecurityRuleCreationFailure
+				return
+			}
+			fmt.Fprintln(output, "SUCCESS")
+			continue
+		}
 
-	_, err = executeWithStatus(func() (autorest.Response, error) {
-		respChan, errChan := ruleClient.CreateOrUpdate(resourceGroupName, *frontEndNSG.Name, frontendSSHRuleName, frontendSSHRule, cancel)
-		return (<-respChan).Response, <-errChan
-	}, fmt.Sprintf("Creating Security Rule '%s'", *frontendSSHRule.Description))
-	if nil != err {
-		exitStatus = ExitSecurityRuleCreationFailure
-		return
-	}
+		for _, declaredRule := range group.Rules {
+			securityRule, err := declaredRule.ToSecurityRule()
+			if nil != err {
+				fmt.Fprintf(os.Stderr, "Fatal Error: %v\n", err)
+				exitStatus = ExitSecurityRuleCreationFailure
+				return
+			}
 
-	frontendHTTPRuleName := "ALLOW-HTTP"
-	frontendHTTPRule := network.SecurityRule{
-		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
-			Access: network.SecurityRuleAccessAllow,
-			DestinationAddressPrefix: &anyAddressPrefix,
-			DestinationPortRange:     to.StringPtr("80"),
-			Direction:                network.SecurityRuleDirectionInbound,
-			Description:              to.StringPtr("Allow HTTP"),
-			Priority:                 to.Int32Ptr(101),
-			Protocol:                 network.SecurityRuleProtocolTCP,
-			SourceAddressPrefix:      &anyAddressPrefix,
-			SourcePortRange:          &anyPortRange,
-		},
+			err = logStatus(func() error {
+				future, err := ruleClient.CreateOrUpdate(ctx, resourceGroupName, group.Name, declaredRule.Name, securityRule)
+				if nil != err {
+					return err
+				}
+				return future.WaitForCompletionRef(ctx, ruleClient.Client)
+			}(), fmt.Sprintf("Creating Security Rule '%s'", declaredRule.Name))
+			if nil != err {
+				exitStatus = ExitSecurityRuleCreationFailure
+				return
+			}
+		}
 	}
 
-	executeWithStatus(func() (autorest.Response, error) {
-		respChan, errChan := ruleClient.CreateOrUpdate(resourceGroupName, *frontEndNSG.Name, frontendHTTPRuleName, frontendHTTPRule, cancel)
-		return (<-respChan).Response, <-errChan
-	}, fmt.Sprintf("Creating Security Rule '%s'", *frontendHTTPRule.Description))
+	//Create Subnets to host Virtual Machines which will be protected by the rules above.
+	subNetClient := network.NewSubnetsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	subNetClient.Authorizer = bearer
 
-	if nil != err {
-		exitStatus = ExitSecurityRuleCreationFailure
-		return
-	}
+	for _, declaredSubnet := range ruleSet.Subnets {
+		attachedGroup, ok := groups[declaredSubnet.Group]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Fatal Error: subnet %q references undeclared group %q\n", declaredSubnet.Name, declaredSubnet.Group)
+			exitStatus = ExitSubnetCreationFailure
+			return
+		}
 
-	sqlRuleName := "ALLOW-SQL"
-	backendSQLRule := network.SecurityRule{
-		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
-			Access: network.SecurityRuleAccessAllow,
-			DestinationAddressPrefix: &anyAddressPrefix,
-			DestinationPortRange:     to.StringPtr("1433"),
-			Direction:                network.SecurityRuleDirectionInbound,
-			Description:              to.StringPtr("Allow SQL"),
-			Priority:                 to.Int32Ptr(100),
-			Protocol:                 network.SecurityRuleProtocolTCP,
-			SourceAddressPrefix:      frontendAddressPrefix,
-			SourcePortRange:          &anyPortRange,
-		},
-	}
+		subnetName := declaredSubnet.Name
+		addressPrefix := declaredSubnet.AddressPrefix
+		subnet := network.Subnet{
+			Name: &subnetName,
+			SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+				AddressPrefix:        &addressPrefix,
+				NetworkSecurityGroup: &attachedGroup,
+			},
+		}
 
-	executeWithStatus(func() (autorest.Response, error) {
-		respChan, errChan := ruleClient.CreateOrUpdate(resourceGroupName, *backEndNSG.Name, sqlRuleName, backendSQLRule, cancel)
-		return (<-respChan).Response, <-errChan
-	}, fmt.Sprintf("Creating Security Rule \"%s\"", sqlRuleName))
-
-	outDenyName := "DENY-OUT"
-	backendOutboundRule := network.SecurityRule{
-		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
-			Access: network.SecurityRuleAccessDeny,
-			DestinationAddressPrefix: &anyAddressPrefix,
-			DestinationPortRange:     &anyPortRange,
-			Direction:                network.SecurityRuleDirectionOutbound,
-			Description:              to.StringPtr("Deny Outbound traffic"),
-			Priority:                 to.Int32Ptr(100),
-			Protocol:                 network.SecurityRuleProtocolAsterisk,
-			SourceAddressPrefix:      &anyAddressPrefix,
-			SourcePortRange:          &anyPortRange,
-		},
+		err = logStatus(func() error {
+			future, err := subNetClient.CreateOrUpdate(ctx, resourceGroupName, vNetName, *subnet.Name, subnet)
+			if nil != err {
+				return err
+			}
+			return future.WaitForCompletionRef(ctx, subNetClient.Client)
+		}(), fmt.Sprintf("Creating Subnet '%s'", *subnet.Name))
+		if err != nil {
+			exitStatus = ExitSubnetCreationFailure
+			return
+		}
 	}
 
-	executeWithStatus(func() (autorest.Response, error) {
-		respChan, errChan := ruleClient.CreateOrUpdate(resourceGroupName, *backEndNSG.Name, outDenyName, backendOutboundRule, cancel)
-		return (<-respChan).Response, <-errChan
-	}, fmt.Sprintf("Creating Security Rule \"%s\"", outDenyName))
-
 	// Give the user time to go inspect their subscription if they desire.
 	if pause {
 		fmt.Printf("Press Enter to continue...")
@@ -273,16 +217,20 @@ func main() {
 }
 
 func init() {
-	// Setup execution environment
-	subscriptionID = os.Getenv(azureEnvVarNameSubscriptionID)
-	clientID = os.Getenv(azureEnvVarNameClientID)
-	clientSecret = os.Getenv(azureEnvVarNameClientSecret)
-	tenantID = os.Getenv(azureEnvVarNameTenantID)
-
 	useQuiet := flag.Bool("quiet", false, "Prevents status messages from being printed to stdout.")
 	flag.BoolVar(&pause, "pause", false, "After all sample assets are created, wait for user response before removing all assets created for this sample.")
 	flag.UintVar(&delay, "delay", 0, "An alternative to 'pause' which waits the specified number of seconds before removing all assets created for this sample.")
 	flag.BoolVar(&help, "help", false, "Instead of executing this sample, enumerates the available flags.")
+	flag.StringVar(&rulesFile, "rules", "rules.sample.yaml", "Path to a YAML or JSON rule-set file declaring the Network Security Groups, subnets and rules to create.")
+	flag.BoolVar(&reconcile, "reconcile", false, "Diff declared rules against what already exists on each Network Security Group instead of blindly creating them, so repeated runs are idempotent.")
+	flag.BoolVar(&prune, "prune", false, "When combined with -reconcile, deletes existing rules carrying -prune-prefix that are no longer declared in the rule-set.")
+	flag.StringVar(&prunePrefix, "prune-prefix", "networkSecurityGroupSample-", "Name prefix that scopes which existing rules -prune is allowed to delete.")
+	flag.StringVar(&authMethod, "auth-method", string(iam.MethodServicePrincipal), "Authentication method to use: service-principal, device-flow, msi or cli.")
+	flag.StringVar(&flagSubscriptionID, "subscription-id", "", "Azure Subscription ID. Overrides the AZURE_SUBSCRIPTION_ID environment variable.")
+	flag.StringVar(&flagClientID, "client-id", "", "Azure Client ID. Overrides the AZURE_CLIENT_ID environment variable.")
+	flag.StringVar(&flagClientSecret, "client-secret", "", "Azure Client Secret. Overrides the AZURE_CLIENT_SECRET environment variable.")
+	flag.StringVar(&flagTenantID, "tenant-id", "", "Azure Tenant ID. Overrides the AZURE_TENANT_ID environment variable.")
+	flag.StringVar(&cloud, "cloud", "", "Azure cloud to target: AzurePublicCloud, AzureChinaCloud, AzureUSGovernmentCloud, AzureGermanCloud, or a path ending in .json to an Azure Stack Hub metadata file. Defaults to AZURE_ENVIRONMENT, then AzurePublicCloud.")
 	flag.Parse()
 
 	if help {
@@ -296,47 +244,61 @@ func init() {
 		output = os.Stdout
 	}
 
-	if errs := validateParameters(); len(errs) > 0 {
+	var errs []error
+	cfg, errs = config.Load(iam.Method(authMethod), config.Overrides{
+		SubscriptionID: flagSubscriptionID,
+		ClientID:       flagClientID,
+		ClientSecret:   flagClientSecret,
+		TenantID:       flagTenantID,
+	})
+	if len(errs) > 0 {
 		for _, err := range errs {
 			fmt.Fprintf(os.Stderr, "Invalid argument. Details: %v\n", err)
 		}
 		return
 	}
 
-	//Authenticate
-
-	authConfig, err := adal.NewOAuthConfig(azure.PublicCloud.ActiveDirectoryEndpoint, tenantID)
+	var err error
+	environment, err = config.ResolveEnvironment(cloud)
 	if nil != err {
-		fmt.Fprint(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, "Fatal Error: %v\n", err)
 		return
 	}
 
-	token, err = adal.NewServicePrincipalToken(*authConfig, clientID, clientSecret, azure.PublicCloud.ResourceManagerEndpoint)
+	//Authenticate
+
+	authorizer, err = iam.GetAuthorizer(iam.Method(authMethod), cfg, environment)
 	if nil != err {
 		fmt.Fprint(os.Stderr, err)
 		return
 	}
 }
 
-func createNetworkSecurityGroup(client network.SecurityGroupsClient, resourceGroupName string, name string, cancel <-chan struct{}) (network.SecurityGroup, error) {
+func createNetworkSecurityGroup(ctx context.Context, client network.SecurityGroupsClient, resourceGroupName string, name string) (network.SecurityGroup, error) {
 	args := network.SecurityGroup{
 		Name:     &name,
 		Location: &sampleLocation,
 	}
-	_, err := executeWithStatus(func() (autorest.Response, error) {
-		respChan, errChan := client.CreateOrUpdate(resourceGroupName, name, args, cancel)
-		return (<-respChan).Response, <-errChan
-	}, fmt.Sprintf("Creating Network Security Group '%s'", name))
 
-	result, err := client.Get(resourceGroupName, *args.Name, "")
-	return result, err
+	err := logStatus(func() error {
+		future, err := client.CreateOrUpdate(ctx, resourceGroupName, name, args)
+		if nil != err {
+			return err
+		}
+		return future.WaitForCompletionRef(ctx, client.Client)
+	}(), fmt.Sprintf("Creating Network Security Group '%s'", name))
+	if nil != err {
+		return network.SecurityGroup{}, err
+	}
+
+	return client.Get(ctx, resourceGroupName, *args.Name, "")
 }
 
-func createResourceGroup(cancel <-chan struct{}) (resources.GroupsClient, string, error) {
-	resourceGroupClient := resources.NewGroupsClient(subscriptionID)
-	resourceGroupClient.Authorizer = autorest.NewBearerAuthorizer(token)
+func createResourceGroup(ctx context.Context) (resources.GroupsClient, string, error) {
+	resourceGroupClient := resources.NewGroupsClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	resourceGroupClient.Authorizer = authorizer
 
-	resourceGroupName, err := getUniqueResourceGroupName(resourceGroupClient)
+	resourceGroupName, err := getUniqueResourceGroupName(ctx, resourceGroupClient)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v", err)
 		return resourceGroupClient, resourceGroupName, err
@@ -346,26 +308,25 @@ func createResourceGroup(cancel <-chan struct{}) (resources.GroupsClient, string
 		Location: &sampleLocation,
 	}
 
-	fmt.Fprintf(output, "Creating Resource Group '%s'...", resourceGroupName)
-	_, err = resourceGroupClient.CreateOrUpdate(resourceGroupName, resourceGroupParameters)
+	_, err = resourceGroupClient.CreateOrUpdate(ctx, resourceGroupName, resourceGroupParameters)
+	logStatus(err, fmt.Sprintf("Creating Resource Group '%s'", resourceGroupName))
 	if err != nil {
-		fmt.Fprintln(output, "FAILED")
-		fmt.Fprintf(os.Stderr, "\tError: %v\n", err)
 		return resourceGroupClient, "", err
 	}
-	fmt.Fprintln(output, "SUCCESS")
 	return resourceGroupClient, resourceGroupName, err
 }
 
-func deleteResourceGroup(client resources.GroupsClient, name string, cancel <-chan struct{}) error {
-	_, err := executeWithStatus(func() (autorest.Response, error) {
-		respChan, errChan := client.Delete(name, cancel)
-		return <-respChan, <-errChan
-	}, fmt.Sprintf("Deleting Resource Group '%s'", name))
-	return err
+func deleteResourceGroup(ctx context.Context, client resources.GroupsClient, name string) error {
+	return logStatus(func() error {
+		future, err := client.Delete(ctx, name)
+		if nil != err {
+			return err
+		}
+		return future.WaitForCompletionRef(ctx, client.Client)
+	}(), fmt.Sprintf("Deleting Resource Group '%s'", name))
 }
 
-func createVirtualNetwork(resourceGroupName string, cancel <-chan struct{}) (network.VirtualNetworksClient, string, error) {
+func createVirtualNetwork(ctx context.Context, resourceGroupName string) (network.VirtualNetworksClient, string, error) {
 	const networkName = "sampleVirtualNetwork"
 
 	vNetParameters := network.VirtualNetwork{
@@ -377,118 +338,64 @@ func createVirtualNetwork(resourceGroupName string, cancel <-chan struct{}) (net
 		},
 	}
 
-	vNetClient := network.NewVirtualNetworksClient(subscriptionID)
-	vNetClient.Authorizer = autorest.NewBearerAuthorizer(token)
+	vNetClient := network.NewVirtualNetworksClientWithBaseURI(environment.ResourceManagerEndpoint, cfg.SubscriptionID)
+	vNetClient.Authorizer = authorizer
 
-	_, err := executeWithStatus(func() (autorest.Response, error) {
-		respChan, errChan := vNetClient.CreateOrUpdate(resourceGroupName, networkName, vNetParameters, cancel)
-		return (<-respChan).Response, <-errChan
-	}, fmt.Sprintf("Creating Virtual Network '%s'", networkName))
+	err := logStatus(func() error {
+		future, err := vNetClient.CreateOrUpdate(ctx, resourceGroupName, networkName, vNetParameters)
+		if nil != err {
+			return err
+		}
+		return future.WaitForCompletionRef(ctx, vNetClient.Client)
+	}(), fmt.Sprintf("Creating Virtual Network '%s'", networkName))
 
 	return vNetClient, networkName, err
 }
 
-func validateParameters() []error {
-	const preferredGUIDFormat guid.Format = guid.FormatD
-	const uuidErrTemplate = "argument '%s' was not of type Uuid as expected"
-
-	errs := make([]error, 0)
-
-	if "" == tenantID {
-		errs = append(errs, newMissingAzureAuthError("Azure Tenant ID", azureEnvVarNameTenantID))
-	} else if parsed, err := guid.Parse(tenantID); nil != err {
-		errs = append(errs, fmt.Errorf(uuidErrTemplate, azureEnvVarNameTenantID))
-	} else {
-		tenantID = parsed.Stringf(preferredGUIDFormat)
-	}
-
-	if "" == subscriptionID {
-		errs = append(errs, newMissingAzureAuthError("Azure Subscription ID", azureEnvVarNameSubscriptionID))
-	} else if parsed, err := guid.Parse(subscriptionID); nil != err {
-		errs = append(errs, fmt.Errorf(uuidErrTemplate, azureEnvVarNameSubscriptionID))
-	} else {
-		subscriptionID = parsed.Stringf(preferredGUIDFormat)
-	}
-
-	if "" == clientID {
-		errs = append(errs, newMissingAzureAuthError("Azure Client ID", azureEnvVarNameClientID))
-	} else if parsed, err := guid.Parse(clientID); nil != err {
-		errs = append(errs, fmt.Errorf(uuidErrTemplate, azureEnvVarNameClientID))
-	} else {
-		clientID = parsed.Stringf(preferredGUIDFormat)
-	}
-
-	if "" == clientSecret {
-		errs = append(errs, newMissingAzureAuthError("Azure Client Secret", azureEnvVarNameClientSecret))
-	}
-
-	return errs
-}
-
-func newMissingAzureAuthError(pretty string, envVarName string) error {
-	formatted := fmt.Sprintf("No value was provieded to act as the %s. Set enviroment variable \"%s\"", pretty, envVarName)
-	return errors.New(formatted)
-}
-
-func getUniqueResourceGroupName(client resources.GroupsClient) (string, error) {
+func getUniqueResourceGroupName(ctx context.Context, client resources.GroupsClient) (string, error) {
 	const resourceGroupNamePrefix = "networkSecurityGroupSample"
-	groupList, err := client.List("", nil)
+
+	page, err := client.List(ctx, "", nil)
 	if nil != err {
 		return "", err
 	}
 
-	if http.StatusOK == groupList.Response.StatusCode {
-		any := false
-		seen := []string{}
-		for _, rg := range *groupList.Value {
+	seen := []string{}
+	for ; page.NotDone(); err = page.NextWithContext(ctx) {
+		if nil != err {
+			return "", err
+		}
+		for _, rg := range page.Values() {
 			if strings.HasPrefix(*rg.Name, resourceGroupNamePrefix) {
-				any = true
 				seen = append(seen, *rg.Name)
 			}
 		}
-		sort.Strings(seen)
-		if any && seen[0] == resourceGroupNamePrefix {
-			count := len(seen) - 1
-			for i := 0; i < count; i++ {
-				candidate := fmt.Sprintf("%s%d", resourceGroupNamePrefix, i)
-				if seen[i+1] != candidate {
-					return candidate, nil
-				}
+	}
+
+	sort.Strings(seen)
+	if len(seen) > 0 && seen[0] == resourceGroupNamePrefix {
+		count := len(seen) - 1
+		for i := 0; i < count; i++ {
+			candidate := fmt.Sprintf("%s%d", resourceGroupNamePrefix, i)
+			if seen[i+1] != candidate {
+				return candidate, nil
 			}
-			return fmt.Sprintf("%s%d", resourceGroupNamePrefix, len(seen)-1), nil
 		}
-		return resourceGroupNamePrefix, nil
+		return fmt.Sprintf("%s%d", resourceGroupNamePrefix, len(seen)-1), nil
 	}
-	return "", fmt.Errorf("Bad response: %d", groupList.Response.StatusCode)
+	return resourceGroupNamePrefix, nil
 }
 
-func executeWithStatus(operation func() (autorest.Response, error), message string) (response autorest.Response, err error) {
+// logStatus prints a consistent "<message>...SUCCESS"/"...FAILED" status
+// line for a long-running operation's outcome and returns err unchanged, so
+// callers can use it inline without losing error propagation.
+func logStatus(err error, message string) error {
 	fmt.Fprintf(output, "%s...", message)
-
-	response, err = operation()
-
-	if nil == err && http.StatusOK == response.StatusCode {
+	if nil == err {
 		fmt.Fprintln(output, "SUCCESS")
 	} else {
 		fmt.Fprintln(output, "FAILED")
-		fmt.Fprint(os.Stderr, getFailureStatus(err, response))
-	}
-	return
-}
-
-func getFailureStatus(err error, response autorest.Response) string {
-	retval := ""
-	if response.Response != nil {
-		retval += fmt.Sprintf("\tStatus Code: %d\n\tStatus: %s\n", response.StatusCode, response.Status)
-	}
-
-	if nil != err {
-		retval += fmt.Sprintf("\tError: %v\n", err)
-	}
-
-	if "" == retval {
-		retval = "An unknown error occurred.\n"
+		fmt.Fprintf(os.Stderr, "\tError: %v\n", err)
 	}
-
-	return retval
+	return err
 }